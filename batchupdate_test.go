@@ -0,0 +1,70 @@
+package fastsql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewUpdate(t *testing.T) {
+	u, err := newUpdate("UPDATE t SET col1=?, col2=? WHERE pk=?")
+	if err != nil {
+		t.Fatalf("newUpdate returned unexpected error: %v", err)
+	}
+
+	if u.table != "t" {
+		t.Errorf("table = %q, want %q", u.table, "t")
+	}
+
+	if u.pkCol != "pk" {
+		t.Errorf("pkCol = %q, want %q", u.pkCol, "pk")
+	}
+
+	wantSetCols := []string{"col1", "col2"}
+	if !reflect.DeepEqual(u.setCols, wantSetCols) {
+		t.Errorf("setCols = %v, want %v", u.setCols, wantSetCols)
+	}
+}
+
+func TestNewUpdateInvalidTemplate(t *testing.T) {
+	if _, err := newUpdate("SELECT * FROM t"); err == nil {
+		t.Fatal("newUpdate(non-UPDATE query) = nil error, want an error")
+	}
+}
+
+// TestDedupeUpdateRowsByPKLastWriteWins guards against the CASE-WHEN
+// generation bug where two BatchUpdate calls for the same primary key within
+// one flush window silently kept the earlier call's values: SQL's CASE
+// returns the first matching WHEN, so flushUpdate must dedupe rows by pk
+// (keeping the last-buffered row) before building the CASE expression.
+func TestDedupeUpdateRowsByPKLastWriteWins(t *testing.T) {
+	rows := [][]interface{}{
+		{"first", 1},
+		{"second", 2},
+		{"first-updated", 1},
+	}
+
+	got := dedupeUpdateRowsByPK(rows, 1)
+
+	want := [][]interface{}{
+		{"first-updated", 1},
+		{"second", 2},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeUpdateRowsByPK() = %v, want %v", got, want)
+	}
+}
+
+func TestDedupeUpdateRowsByPKNoDuplicates(t *testing.T) {
+	rows := [][]interface{}{
+		{"a", 1},
+		{"b", 2},
+		{"c", 3},
+	}
+
+	got := dedupeUpdateRowsByPK(rows, 1)
+
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("dedupeUpdateRowsByPK() = %v, want %v (unchanged)", got, rows)
+	}
+}
@@ -0,0 +1,45 @@
+package fastsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBatchInsertContextCanceled verifies that an already-canceled context
+// passed to BatchInsertContext surfaces context.Canceled from the flush it
+// triggers, rather than being silently swallowed or blocking.
+func TestBatchInsertContextCanceled(t *testing.T) {
+	db, err := Open("fastsql_fake", t.Name(), 1)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = db.BatchInsertContext(ctx, "INSERT INTO t (a, b) VALUES (?, ?)", 1, 2)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("BatchInsertContext(canceled ctx) error = %v, want context.Canceled", err)
+	}
+}
+
+// TestSetFlushTimeoutExceeded verifies that a flush which outlives
+// SetFlushTimeout is aborted with context.DeadlineExceeded.
+func TestSetFlushTimeoutExceeded(t *testing.T) {
+	db, err := Open("fastsql_fake", t.Name(), 1)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+
+	state, _ := fakeConnStates.LoadOrStore(t.Name(), &fakeConnState{})
+	state.(*fakeConnState).execDelay = 50 * time.Millisecond
+
+	db.SetFlushTimeout(10 * time.Millisecond)
+
+	err = db.BatchInsert("INSERT INTO t (a, b) VALUES (?, ?)", 1, 2)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BatchInsert() error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,79 @@
+package fastsql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseInsertInto(t *testing.T) {
+	table, columns, err := parseInsertInto("INSERT INTO t (a, b, `c`)")
+	if err != nil {
+		t.Fatalf("parseInsertInto returned unexpected error: %v", err)
+	}
+
+	if table != "t" {
+		t.Errorf("table = %q, want %q", table, "t")
+	}
+
+	want := []string{"a", "b", "c"}
+	if len(columns) != len(want) {
+		t.Fatalf("columns = %v, want %v", columns, want)
+	}
+
+	for i := range want {
+		if columns[i] != want[i] {
+			t.Errorf("columns[%d] = %q, want %q", i, columns[i], want[i])
+		}
+	}
+}
+
+func TestParseInsertIntoNoColumnList(t *testing.T) {
+	_, _, err := parseInsertInto("INSERT INTO t")
+
+	if !errors.Is(err, errCopyFromUnsupportedShape) {
+		t.Fatalf("parseInsertInto(no column list) error = %v, want errCopyFromUnsupportedShape", err)
+	}
+}
+
+func TestRewritePlaceholders(t *testing.T) {
+	tests := []struct {
+		name       string
+		driverName string
+		query      string
+		want       string
+	}{
+		{
+			name:       "mysql left untouched",
+			driverName: "mysql",
+			query:      "INSERT INTO t (a, b) VALUES (?, ?)",
+			want:       "INSERT INTO t (a, b) VALUES (?, ?)",
+		},
+		{
+			name:       "postgres rewritten",
+			driverName: "postgres",
+			query:      "INSERT INTO t (a, b) VALUES (?, ?)",
+			want:       "INSERT INTO t (a, b) VALUES ($1, $2)",
+		},
+		{
+			name:       "pgx rewritten",
+			driverName: "pgx",
+			query:      "UPDATE t SET a=? WHERE pk IN (?, ?)",
+			want:       "UPDATE t SET a=$1 WHERE pk IN ($2, $3)",
+		},
+		{
+			name:       "question mark inside string literal is untouched",
+			driverName: "postgres",
+			query:      "INSERT INTO t (a) VALUES ('is this a ?')",
+			want:       "INSERT INTO t (a) VALUES ('is this a ?')",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rewritePlaceholders(tt.driverName, tt.query)
+			if got != tt.want {
+				t.Errorf("rewritePlaceholders(%q, %q) = %q, want %q", tt.driverName, tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package fastsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fakeDriver is a minimal database/sql driver used to exercise fastsql's
+// flushing, locking, and context-cancellation behavior without a real
+// database connection.
+type fakeDriver struct{}
+
+func init() {
+	sql.Register("fastsql_fake", fakeDriver{})
+}
+
+// fakeConnStates holds one *fakeConnState per DSN, so each test gets its own
+// isolated exec/query counters by using t.Name() as the DSN.
+var fakeConnStates sync.Map
+
+// fakeConnState tracks what's happened against one DSN, shared across every
+// connection opened for it.
+type fakeConnState struct {
+	execCount  int32
+	queryCount int32
+	execDelay  time.Duration
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	state, _ := fakeConnStates.LoadOrStore(name, &fakeConnState{})
+	return &fakeConn{state: state.(*fakeConnState)}, nil
+}
+
+type fakeConn struct {
+	state *fakeConnState
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{state: c.state}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeStmt struct {
+	state *fakeConnState
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	atomic.AddInt32(&s.state.execCount, 1)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt32(&s.state.queryCount, 1)
+	return &fakeRows{}, nil
+}
+
+// ExecContext honors execDelay and context cancellation/timeout, so tests
+// can exercise SetFlushTimeout and an already-canceled context deterministically.
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.state.execDelay > 0 {
+		select {
+		case <-time.After(s.state.execDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	atomic.AddInt32(&s.state.execCount, 1)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct{}
+
+func (r *fakeRows) Columns() []string              { return nil }
+func (r *fakeRows) Close() error                   { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
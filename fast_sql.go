@@ -10,15 +10,28 @@
 package fastsql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
 )
 
 var (
-	dupeRegexp   = regexp.MustCompile(`(?i)on duplicate key update`)
-	valuesRegexp = regexp.MustCompile(`(?i)values`)
+	dupeRegexp       = regexp.MustCompile(`(?i)on duplicate key update`)
+	onConflictRegexp = regexp.MustCompile(`(?i)on conflict`)
+	valuesRegexp     = regexp.MustCompile(`(?i)values`)
+	insertIntoRegexp = regexp.MustCompile(`(?i)insert\s+into\s+([^\s(]+)\s*\(([^)]*)\)`)
+	updateRegexp     = regexp.MustCompile(`(?i)^\s*update\s+([^\s]+)\s+set\s+(.+?)\s+where\s+([^\s=]+)\s*=\s*\?\s*$`)
+	deleteRegexp     = regexp.MustCompile(`(?i)^\s*delete\s+from\s+([^\s]+)\s+where\s+([^\s=]+)\s*=\s*\?\s*$`)
 )
 
 // DB is a database handle that embeds the standard library's sql.DB struct.
@@ -31,6 +44,29 @@ type DB struct {
 	driverName         string
 	flushInterval      uint
 	batchInserts       map[string]*insert
+	batchUpdates       map[string]*update
+	batchDeletes       map[string]*deleteBatch
+	preparedBatches    map[string]*preparedBatch
+	returningCols      map[string][]string
+	useCopyFrom        bool
+
+	// mu guards batchInserts, batchUpdates, batchDeletes, preparedBatches,
+	// prepstmts, returningCols, and useCopyFrom so that Batch*/Add/Flush,
+	// SetReturningColumns, and UseCopyFrom can be called concurrently.
+	mu           sync.Mutex
+	flushPolicy  FlushPolicy
+	flusherStop  chan struct{}
+	flusherDone  chan struct{}
+	flushTimeout time.Duration
+}
+
+// FlushPolicy configures when BatchInsert auto-flushes a batch beyond the
+// plain row-count trigger already driven by Open's flushInterval. A zero
+// value for any field disables that trigger.
+type FlushPolicy struct {
+	MaxRows  uint
+	MaxBytes int
+	MaxAge   time.Duration
 }
 
 // Close is the same a sql.Close, but first closes any opened prepared statements.
@@ -39,10 +75,15 @@ func (d *DB) Close() error {
 		wg sync.WaitGroup
 	)
 
+	d.stopFlusher()
+
 	if err := d.FlushAll(); err != nil {
 		return err
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	wg.Add(1)
 	go func(wg *sync.WaitGroup) {
 		defer wg.Done()
@@ -61,6 +102,19 @@ func (d *DB) Close() error {
 		}
 	}(&wg)
 
+	wg.Add(1)
+	go func(wg *sync.WaitGroup) {
+		defer wg.Done()
+
+		for _, pb := range d.preparedBatches {
+			_ = pb.fullStmt.Close()
+
+			if pb.tailStmt != nil {
+				_ = pb.tailStmt.Close()
+			}
+		}
+	}(&wg)
+
 	wg.Wait()
 	return d.DB.Close()
 }
@@ -83,59 +137,381 @@ func Open(driverName, dataSourceName string, flushInterval uint) (*DB, error) {
 		driverName:         driverName,
 		flushInterval:      flushInterval,
 		batchInserts:       make(map[string]*insert),
+		batchUpdates:       make(map[string]*update),
+		batchDeletes:       make(map[string]*deleteBatch),
+		preparedBatches:    make(map[string]*preparedBatch),
+		returningCols:      make(map[string][]string),
+		useCopyFrom:        true,
 	}, err
 }
 
+// SetReturningColumns configures the primary-key (or other) columns that
+// BatchInsertReturning should append as a PostgreSQL RETURNING clause for
+// the given single-row query template. It has no effect on MySQL, where
+// BatchInsertReturning instead derives IDs from LastInsertId().
+func (d *DB) SetReturningColumns(query string, cols ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.returningCols[query] = cols
+}
+
+// SetFlushTimeout bounds how long an auto-triggered flush (one fired by
+// hitting flushInterval/FlushPolicy, or by the background age-based flusher)
+// is allowed to run, by wrapping its context with context.WithTimeout. It has
+// no effect on flushes requested explicitly via a *Context method's own ctx.
+func (d *DB) SetFlushTimeout(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.flushTimeout = timeout
+}
+
+// flushContext wraps ctx with flushTimeout, if one is set, for use by an
+// auto-triggered flush. The returned cancel func must be called once the
+// flush completes.
+func (d *DB) flushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.flushTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d.flushTimeout)
+}
+
+// SetFlushPolicy installs a FlushPolicy and (re)starts the background
+// flusher goroutine that auto-flushes batch inserts that have aged past
+// policy.MaxAge. It's safe to call more than once; the previous goroutine,
+// if any, is stopped first.
+func (d *DB) SetFlushPolicy(policy FlushPolicy) {
+	d.stopFlusher()
+
+	d.mu.Lock()
+	d.flushPolicy = policy
+	d.mu.Unlock()
+
+	d.startFlusher()
+}
+
+// startFlusher spawns the background goroutine that flushes aged-out batch
+// inserts. It is a no-op when flushPolicy.MaxAge is unset.
+func (d *DB) startFlusher() {
+	if d.flushPolicy.MaxAge <= 0 {
+		return
+	}
+
+	interval := d.flushPolicy.MaxAge / 4
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+
+	d.flusherStop = make(chan struct{})
+	d.flusherDone = make(chan struct{})
+
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.flushAged()
+			case <-stop:
+				return
+			}
+		}
+	}(d.flusherStop, d.flusherDone)
+}
+
+// stopFlusher stops a running background flusher goroutine, if any, and
+// waits for it to exit.
+func (d *DB) stopFlusher() {
+	if d.flusherStop == nil {
+		return
+	}
+
+	close(d.flusherStop)
+	<-d.flusherDone
+
+	d.flusherStop = nil
+	d.flusherDone = nil
+}
+
+// flushAged flushes any batch insert whose oldest buffered row is older than
+// flushPolicy.MaxAge.
+func (d *DB) flushAged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	for _, in := range d.batchInserts {
+		if in.createdAt.IsZero() {
+			continue
+		}
+
+		if now.Sub(in.createdAt) >= d.flushPolicy.MaxAge {
+			ctx, cancel := d.flushContext(context.Background())
+			_ = d.flushInsert(ctx, in)
+			cancel()
+		}
+	}
+}
+
+// UseCopyFrom controls whether BatchInsert uses PostgreSQL's COPY FROM STDIN
+// protocol instead of an extended multi-values INSERT. This relies on
+// lib/pq's special-cased handling of the COPY magic string in Prepare, so it
+// only applies to driverName "postgres"; it has no effect on "pgx" (whose
+// stdlib adapter has no such special case) or any other driver.
+func (d *DB) UseCopyFrom(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.useCopyFrom = enabled
+}
+
 // BatchInsert takes a singlular INSERT query and converts it to a batch-insert query for the caller.  A batch-insert is ran every time BatchInsert is called a multiple of flushInterval times.
-func (d *DB) BatchInsert(query string, params ...interface{}) (err error) {
+func (d *DB) BatchInsert(query string, params ...interface{}) error {
+	return d.BatchInsertContext(context.Background(), query, params...)
+}
+
+// BatchInsertContext is BatchInsert, but the ctx is threaded through to the
+// underlying Prepare/Exec calls if this call is the one that triggers a flush.
+func (d *DB) BatchInsertContext(ctx context.Context, query string, params ...interface{}) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if _, ok := d.batchInserts[query]; !ok {
 		d.batchInserts[query] = newInsert()
 	} //if
 
+	in := d.batchInserts[query]
+
 	// Only split out query the first time Insert is called
-	if d.batchInserts[query].queryPart1 == "" {
-		d.batchInserts[query].splitQuery(query)
+	if in.queryPart1 == "" {
+		if err = in.splitQuery(query); err != nil {
+			delete(d.batchInserts, query)
+			return err
+		}
+	}
+
+	if in.createdAt.IsZero() {
+		in.createdAt = time.Now()
 	}
 
-	d.batchInserts[query].insertCtr++
+	in.insertCtr++
 
 	// Build VALUES seciton of query and add to parameter slice
-	d.batchInserts[query].values += d.batchInserts[query].queryPart2
-	d.batchInserts[query].bindParams = append(d.batchInserts[query].bindParams, params...)
+	in.values += in.queryPart2
+	in.bindParams = append(in.bindParams, params...)
+
+	for _, p := range params {
+		in.byteEstimate += estimateParamSize(p)
+	}
 
 	// If the batch interval has been hit, execute a batch insert
-	if d.batchInserts[query].insertCtr >= d.flushInterval {
-		err = d.flushInsert(d.batchInserts[query])
+	if in.insertCtr >= d.flushInterval ||
+		(d.flushPolicy.MaxRows > 0 && in.insertCtr >= d.flushPolicy.MaxRows) ||
+		(d.flushPolicy.MaxBytes > 0 && in.byteEstimate >= d.flushPolicy.MaxBytes) {
+		flushCtx, cancel := d.flushContext(ctx)
+		err = d.flushInsert(flushCtx, in)
+		cancel()
+	}
+
+	return err
+}
+
+// BatchInsertReturning is BatchInsert for callers that need the generated
+// row IDs back. On PostgreSQL it appends a RETURNING clause built from the
+// columns configured via SetReturningColumns and scans each returned row
+// into a newly appended element of the slice dst points to. On MySQL it
+// instead derives sequential IDs from LastInsertId(), relying on the
+// documented behavior that a multi-row INSERT with a single auto-increment
+// column assigns consecutive IDs to the inserted rows.
+func (d *DB) BatchInsertReturning(query string, dst interface{}, params ...interface{}) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.batchInserts[query]; !ok {
+		d.batchInserts[query] = newInsert()
+	} //if
+
+	in := d.batchInserts[query]
+
+	// Only split out query the first time Insert is called
+	if in.queryPart1 == "" {
+		if err = in.splitQuery(query); err != nil {
+			delete(d.batchInserts, query)
+			return err
+		}
+		in.origQuery = query
+	}
+
+	in.returning = true
+	in.returningDst = dst
+	in.insertCtr++
+
+	// Build VALUES seciton of query and add to parameter slice
+	in.values += in.queryPart2
+	in.bindParams = append(in.bindParams, params...)
+
+	if in.insertCtr >= d.flushInterval {
+		ctx, cancel := d.flushContext(context.Background())
+		err = d.flushInsert(ctx, in)
+		cancel()
+	}
+
+	return err
+}
+
+// BatchUpdate takes a singular UPDATE query of the form
+// "UPDATE t SET col1=?, col2=? WHERE pk=?" and converts it to a batch update
+// for the caller. A batch update is ran every time BatchUpdate is called a
+// multiple of flushInterval times. At flush time it's rewritten into a single
+// "col1 = CASE WHEN pk=? THEN ? ... END" statement per SET column plus a
+// "WHERE pk IN (?, ?, ...)" clause, so the whole batch is one round-trip.
+func (d *DB) BatchUpdate(query string, params ...interface{}) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.batchUpdates[query]; !ok {
+		u, parseErr := newUpdate(query)
+		if parseErr != nil {
+			return parseErr
+		}
+
+		d.batchUpdates[query] = u
+	} //if
+
+	u := d.batchUpdates[query]
+
+	if len(params) != len(u.setCols)+1 {
+		return fmt.Errorf("fastsql: batch update expects %d params, got %d", len(u.setCols)+1, len(params))
+	}
+
+	u.rows = append(u.rows, params)
+	u.updateCtr++
+
+	if u.updateCtr >= d.flushInterval {
+		ctx, cancel := d.flushContext(context.Background())
+		err = d.flushUpdate(ctx, u)
+		cancel()
+	}
+
+	return err
+}
+
+// BatchDelete takes a singular DELETE query of the form
+// "DELETE FROM t WHERE pk=?" and converts it to a batch delete for the
+// caller. A batch delete is ran every time BatchDelete is called a multiple
+// of flushInterval times, coalescing into a single
+// "DELETE FROM t WHERE pk IN (?, ?, ...)" statement.
+func (d *DB) BatchDelete(query string, params ...interface{}) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.batchDeletes[query]; !ok {
+		del, parseErr := newDeleteBatch(query)
+		if parseErr != nil {
+			return parseErr
+		}
+
+		d.batchDeletes[query] = del
+	} //if
+
+	del := d.batchDeletes[query]
+
+	if len(params) != 1 {
+		return fmt.Errorf("fastsql: batch delete expects 1 param, got %d", len(params))
+	}
+
+	del.pkVals = append(del.pkVals, params[0])
+	del.deleteCtr++
+
+	if del.deleteCtr >= d.flushInterval {
+		ctx, cancel := d.flushContext(context.Background())
+		err = d.flushDelete(ctx, del)
+		cancel()
 	}
 
 	return err
 }
 
-// FlushAll iterates over all batch inserts and inserts them into the database.
+// FlushAll iterates over all batch inserts, updates, and deletes and runs
+// them against the database.
 func (d *DB) FlushAll() error {
+	return d.FlushAllContext(context.Background())
+}
+
+// FlushAllContext is FlushAll, but ctx is threaded through to the underlying
+// Prepare/Exec calls.
+func (d *DB) FlushAllContext(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	for _, in := range d.batchInserts {
-		if err := d.flushInsert(in); err != nil {
+		if err := d.flushInsert(ctx, in); err != nil {
 			// empty batchInserts
 			d.batchInserts = map[string]*insert{}
 			return err
 		}
 	}
 
+	for _, u := range d.batchUpdates {
+		if err := d.flushUpdate(ctx, u); err != nil {
+			d.batchUpdates = map[string]*update{}
+			return err
+		}
+	}
+
+	for _, del := range d.batchDeletes {
+		if err := d.flushDelete(ctx, del); err != nil {
+			d.batchDeletes = map[string]*deleteBatch{}
+			return err
+		}
+	}
+
 	return nil
 }
 
 // flushInsert performs the acutal batch-insert query.
-func (d *DB) flushInsert(in *insert) error {
+func (d *DB) flushInsert(ctx context.Context, in *insert) error {
 	var (
 		err   error
 		query = in.queryPart1 + in.values[:len(in.values)-1] + in.queryPart3
 	)
 
+	if in.returning {
+		return d.flushInsertReturning(ctx, in)
+	}
+
+	// COPY FROM STDIN is the fast path on PostgreSQL, but it can't express an
+	// upsert, so fall back to the extended-VALUES INSERT below when the query
+	// has an ON DUPLICATE KEY UPDATE / ON CONFLICT clause. This only works via
+	// lib/pq's special-cased handling of the COPY magic string, so it's
+	// restricted to driverName "postgres"; pgx's stdlib adapter has no such
+	// special case and always uses the extended-VALUES path instead.
+	if d.useCopyFrom && d.driverName == "postgres" &&
+		!dupeRegexp.MatchString(query) && !onConflictRegexp.MatchString(query) {
+		err = d.flushInsertCopyFrom(ctx, in)
+
+		// A query with no explicit column list (e.g. "INSERT INTO t VALUES
+		// (?, ?)") can't be parsed into the table/columns COPY FROM needs;
+		// fall back to the extended-VALUES path below instead of failing a
+		// flush that worked fine before COPY FROM existed.
+		if !errors.Is(err, errCopyFromUnsupportedShape) {
+			return err
+		}
+	}
+
 	// Prepare query
 	if _, ok := d.prepstmts[query]; !ok {
 		var stmt *sql.Stmt
 
-		if stmt, err = d.DB.Prepare(query); err == nil {
+		// splitQuery leaves "?" placeholders regardless of driver; Postgres
+		// requires its native $1, $2, ... ordinal markers instead.
+		if stmt, err = d.DB.PrepareContext(ctx, rewritePlaceholders(d.driverName, query)); err == nil {
 			d.prepstmts[query] = stmt
 		} else {
 			return err
@@ -143,7 +519,7 @@ func (d *DB) flushInsert(in *insert) error {
 	}
 
 	// Executate batch insert
-	if _, err = d.prepstmts[query].Exec(in.bindParams...); err != nil {
+	if _, err = d.prepstmts[query].ExecContext(ctx, in.bindParams...); err != nil {
 		return err
 	} //if
 
@@ -151,62 +527,1088 @@ func (d *DB) flushInsert(in *insert) error {
 	in.values = " VALUES"
 	in.bindParams = make([]interface{}, 0)
 	in.insertCtr = 0
+	in.byteEstimate = 0
+	in.createdAt = time.Time{}
 
 	return err
 }
 
-func (d *DB) setDB(dbh *sql.DB) (err error) {
-	if err = dbh.Ping(); err != nil {
+// PreparedBatchInsert registers a named batch under baseQuery, a single-row INSERT
+// statement such as "INSERT INTO t (a, b) VALUES (?, ?)". It pre-computes and
+// prepares one statement sized to exactly batchSize rows, with placeholders
+// adapted to d.driverName ("?" for MySQL/SQLite, "$1..$N" for PostgreSQL), so
+// that rows pushed via Add can be flushed with a single Exec instead of
+// rebuilding and re-preparing a statement on every flush.
+func (d *DB) PreparedBatchInsert(name, baseQuery string, batchSize int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if batchSize < 1 {
+		return fmt.Errorf("fastsql: batchSize must be >= 1, got %d", batchSize)
+	}
+
+	prefix, tuple, err := splitValuesTemplate(baseQuery)
+	if err != nil {
 		return err
 	}
 
-	d.DB = dbh
+	colsPerRow := strings.Count(tuple, "?")
+	if colsPerRow == 0 {
+		return fmt.Errorf("fastsql: no placeholders found in %q", baseQuery)
+	}
+
+	fullQuery := buildBatchQuery(d.driverName, prefix, colsPerRow, batchSize)
+
+	stmt, err := d.DB.Prepare(fullQuery)
+	if err != nil {
+		return err
+	}
+
+	// Re-registering an existing name would otherwise leak the previous
+	// entry's prepared statements.
+	if old, ok := d.preparedBatches[name]; ok {
+		_ = old.fullStmt.Close()
+
+		if old.tailStmt != nil {
+			_ = old.tailStmt.Close()
+		}
+	}
+
+	d.preparedBatches[name] = &preparedBatch{
+		baseQuery:  baseQuery,
+		prefix:     prefix,
+		colsPerRow: colsPerRow,
+		batchSize:  batchSize,
+		buffered:   make([][]interface{}, 0, batchSize),
+		fullStmt:   stmt,
+	}
+
 	return nil
 }
 
-type insert struct {
-	bindParams []interface{}
-	insertCtr  uint
-	queryPart1 string
-	queryPart2 string
-	queryPart3 string
-	values     string
+// Add buffers a row of params for the named prepared batch. Once batchSize
+// rows are buffered, it executes the cached full-size statement in a single
+// round-trip.
+func (d *DB) Add(name string, params ...interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pb, ok := d.preparedBatches[name]
+	if !ok {
+		return fmt.Errorf("fastsql: no prepared batch named %q, call PreparedBatchInsert first", name)
+	}
+
+	if len(params) != pb.colsPerRow {
+		return fmt.Errorf("fastsql: batch %q expects %d params per row, got %d", name, pb.colsPerRow, len(params))
+	}
+
+	pb.buffered = append(pb.buffered, params)
+
+	if len(pb.buffered) >= pb.batchSize {
+		return d.execBatch(pb, pb.fullStmt, pb.batchSize)
+	}
+
+	return nil
 }
 
-func newInsert() *insert {
-	return &insert{
-		bindParams: make([]interface{}, 0),
-		values:     " VALUES",
+// Flush executes whatever rows remain buffered for the named prepared batch,
+// using a second cached statement sized exactly to the remaining row count
+// so the tail of a batch isn't wasted on an oversized statement.
+func (d *DB) Flush(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pb, ok := d.preparedBatches[name]
+	if !ok {
+		return fmt.Errorf("fastsql: no prepared batch named %q, call PreparedBatchInsert first", name)
+	}
+
+	if len(pb.buffered) == 0 {
+		return nil
+	}
+
+	if pb.tailStmt == nil || pb.tailSize != len(pb.buffered) {
+		if pb.tailStmt != nil {
+			_ = pb.tailStmt.Close()
+		}
+
+		tailQuery := buildBatchQuery(d.driverName, pb.prefix, pb.colsPerRow, len(pb.buffered))
+
+		stmt, err := d.DB.Prepare(tailQuery)
+		if err != nil {
+			return err
+		}
+
+		pb.tailStmt = stmt
+		pb.tailSize = len(pb.buffered)
+	}
+
+	return d.execBatch(pb, pb.tailStmt, len(pb.buffered))
+}
+
+// execBatch runs stmt against the first rowCount buffered rows of pb and
+// removes them from the buffer on success.
+func (d *DB) execBatch(pb *preparedBatch, stmt *sql.Stmt, rowCount int) error {
+	bindParams := make([]interface{}, 0, rowCount*pb.colsPerRow)
+	for _, row := range pb.buffered[:rowCount] {
+		bindParams = append(bindParams, row...)
+	}
+
+	if _, err := stmt.Exec(bindParams...); err != nil {
+		return err
 	}
+
+	pb.buffered = pb.buffered[rowCount:]
+
+	return nil
 }
 
-func (in *insert) splitQuery(query string) {
+// flushUpdate performs the actual batch-update query, rewriting the buffered
+// rows into one CASE-based UPDATE statement. SQL's CASE returns the value of
+// the first matching WHEN, so rows are deduped by primary key (keeping the
+// most recently buffered row for each key) before building the statement;
+// otherwise two BatchUpdate calls for the same pk within one flush window
+// would keep the earlier call's values instead of the later one.
+func (d *DB) flushUpdate(ctx context.Context, u *update) error {
+	var err error
+
+	rows := dedupeUpdateRowsByPK(u.rows, len(u.setCols))
+
 	var (
-		ndxOnDupe, ndxValues = -1, -1
-		ndxParens            = strings.LastIndex(query, ")")
+		setClauses = make([]string, len(u.setCols))
+		bindParams = make([]interface{}, 0, len(rows)*(len(u.setCols)+1)+len(rows))
 	)
 
-	// Find "VALUES".
-	valuesMatches := valuesRegexp.FindStringIndex(query)
-	if len(valuesMatches) > 0 {
-		ndxValues = valuesMatches[0]
+	for i, col := range u.setCols {
+		whens := make([]string, len(rows))
+		for r := range rows {
+			whens[r] = "WHEN " + u.pkCol + "=? THEN ?"
+		}
+		setClauses[i] = col + " = CASE " + strings.Join(whens, " ") + " END"
+	}
+
+	for i := range u.setCols {
+		for _, row := range rows {
+			bindParams = append(bindParams, row[len(u.setCols)], row[i])
+		}
 	}
 
-	// Find "ON DUPLICATE KEY UPDATE"
-	dupeMatches := dupeRegexp.FindAllStringIndex(query, -1)
-	if len(dupeMatches) > 0 {
-		ndxOnDupe = dupeMatches[len(dupeMatches)-1][0]
+	pkPlaceholders := make([]string, len(rows))
+	for r, row := range rows {
+		pkPlaceholders[r] = "?"
+		bindParams = append(bindParams, row[len(u.setCols)])
 	}
 
-	// Split out first part of query
-	in.queryPart1 = strings.TrimSpace(query[:ndxValues])
+	query := "UPDATE " + u.table + " SET " + strings.Join(setClauses, ", ") +
+		" WHERE " + u.pkCol + " IN (" + strings.Join(pkPlaceholders, ", ") + ")"
 
-	// If ON DUPLICATE clause exists, separate into 3 parts.
-	// If ON DUPLICATE does not exist, seperate into 2 parts.
-	if ndxOnDupe != -1 {
-		in.queryPart2 = query[ndxValues+6:ndxOnDupe-1] + ","
-		in.queryPart3 = query[ndxOnDupe:]
-	} else {
-		in.queryPart2 = query[ndxValues+6:ndxParens+1] + ","
+	if _, ok := d.prepstmts[query]; !ok {
+		var stmt *sql.Stmt
+
+		// The CASE/IN clauses above are always built with "?" placeholders;
+		// Postgres requires its native $1, $2, ... ordinal markers instead.
+		if stmt, err = d.DB.PrepareContext(ctx, rewritePlaceholders(d.driverName, query)); err == nil {
+			d.prepstmts[query] = stmt
+		} else {
+			return err
+		}
+	}
+
+	if _, err = d.prepstmts[query].ExecContext(ctx, bindParams...); err != nil {
+		return err
+	}
+
+	u.rows = nil
+	u.updateCtr = 0
+
+	return nil
+}
+
+// flushDelete performs the actual batch-delete query, coalescing the
+// buffered primary key values into a single DELETE ... WHERE pk IN (...).
+func (d *DB) flushDelete(ctx context.Context, del *deleteBatch) error {
+	var err error
+
+	placeholders := make([]string, len(del.pkVals))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+
+	query := "DELETE FROM " + del.table + " WHERE " + del.pkCol + " IN (" + strings.Join(placeholders, ", ") + ")"
+
+	if _, ok := d.prepstmts[query]; !ok {
+		var stmt *sql.Stmt
+
+		// The IN clause above is always built with "?" placeholders;
+		// Postgres requires its native $1, $2, ... ordinal markers instead.
+		if stmt, err = d.DB.PrepareContext(ctx, rewritePlaceholders(d.driverName, query)); err == nil {
+			d.prepstmts[query] = stmt
+		} else {
+			return err
+		}
+	}
+
+	if _, err = d.prepstmts[query].ExecContext(ctx, del.pkVals...); err != nil {
+		return err
+	}
+
+	del.pkVals = nil
+	del.deleteCtr = 0
+
+	return nil
+}
+
+// flushInsertReturning performs a batch insert that also propagates the
+// generated row IDs into in.returningDst.
+func (d *DB) flushInsertReturning(ctx context.Context, in *insert) error {
+	if d.driverName == "postgres" || d.driverName == "pgx" {
+		return d.flushInsertReturningPostgres(ctx, in)
+	}
+
+	return d.flushInsertReturningLastID(ctx, in)
+}
+
+// flushInsertReturningPostgres appends a RETURNING clause (configured via
+// SetReturningColumns) to the batch-insert query, runs it as a Query instead
+// of an Exec, and scans each returned row into in.returningDst.
+func (d *DB) flushInsertReturningPostgres(ctx context.Context, in *insert) error {
+	var err error
+
+	cols, ok := d.returningCols[in.origQuery]
+	if !ok || len(cols) == 0 {
+		return fmt.Errorf("fastsql: no returning columns configured for %q, call SetReturningColumns first", in.origQuery)
+	}
+
+	query := in.queryPart1 + in.values[:len(in.values)-1] + in.queryPart3 + " RETURNING " + strings.Join(cols, ", ")
+
+	if _, ok := d.prepstmts[query]; !ok {
+		var stmt *sql.Stmt
+
+		// splitQuery leaves "?" placeholders in queryPart1/2/3 regardless of
+		// driver; Postgres requires its native $1, $2, ... ordinal markers.
+		if stmt, err = d.DB.PrepareContext(ctx, rewritePlaceholders(d.driverName, query)); err == nil {
+			d.prepstmts[query] = stmt
+		} else {
+			return err
+		}
+	}
+
+	rows, err := d.prepstmts[query].QueryContext(ctx, in.bindParams...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		scanDst := make([]interface{}, len(cols))
+		for i := range values {
+			scanDst[i] = &values[i]
+		}
+
+		if err = rows.Scan(scanDst...); err != nil {
+			return err
+		}
+
+		if err = appendReturnedRow(in.returningDst, cols, values); err != nil {
+			return err
+		}
 	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	in.values = " VALUES"
+	in.bindParams = make([]interface{}, 0)
+	in.insertCtr = 0
+	in.byteEstimate = 0
+	in.createdAt = time.Time{}
+
+	return nil
+}
+
+// flushInsertReturningLastID executes the batch insert as a plain Exec and,
+// per MySQL's documented multi-row auto-increment behavior, derives each
+// row's generated ID as LastInsertId()+rowIndex.
+func (d *DB) flushInsertReturningLastID(ctx context.Context, in *insert) error {
+	var (
+		err   error
+		query = in.queryPart1 + in.values[:len(in.values)-1] + in.queryPart3
+	)
+
+	if _, ok := d.prepstmts[query]; !ok {
+		var stmt *sql.Stmt
+
+		if stmt, err = d.DB.PrepareContext(ctx, query); err == nil {
+			d.prepstmts[query] = stmt
+		} else {
+			return err
+		}
+	}
+
+	res, err := d.prepstmts[query].ExecContext(ctx, in.bindParams...)
+	if err != nil {
+		return err
+	}
+
+	firstID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	colsPerRow := strings.Count(in.queryPart2, "?")
+	numRows := len(in.bindParams) / colsPerRow
+
+	for i := 0; i < numRows; i++ {
+		if err = appendReturnedRow(in.returningDst, []string{"id"}, []interface{}{firstID + int64(i)}); err != nil {
+			return err
+		}
+	}
+
+	in.values = " VALUES"
+	in.bindParams = make([]interface{}, 0)
+	in.insertCtr = 0
+	in.byteEstimate = 0
+	in.createdAt = time.Time{}
+
+	return nil
+}
+
+// appendReturnedRow appends one row of column values onto the slice dst
+// points to. If the slice's element type is a struct, values are matched
+// onto exported fields by case-insensitive name; otherwise dst must point to
+// a slice of a single scalar type and cols must have exactly one entry.
+func appendReturnedRow(dst interface{}, cols []string, values []interface{}) error {
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Ptr || dstVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("fastsql: BatchInsertReturning dst must be a pointer to a slice")
+	}
+
+	sliceVal := dstVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	elem := reflect.New(elemType).Elem()
+
+	if elemType.Kind() == reflect.Struct {
+		for i, col := range cols {
+			field := findFieldByName(elem, col)
+			if !field.IsValid() || !field.CanSet() {
+				continue
+			}
+
+			setReflectValue(field, values[i])
+		}
+	} else {
+		if len(values) != 1 {
+			return fmt.Errorf("fastsql: BatchInsertReturning dst element is %s, but %d columns were returned", elemType.Kind(), len(values))
+		}
+
+		setReflectValue(elem, values[0])
+	}
+
+	sliceVal.Set(reflect.Append(sliceVal, elem))
+
+	return nil
+}
+
+// findFieldByName finds a struct field matching name, ignoring case. It does
+// not skip unexported fields; callers check CanSet before assigning.
+func findFieldByName(structVal reflect.Value, name string) reflect.Value {
+	structType := structVal.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		if strings.EqualFold(structType.Field(i).Name, name) {
+			return structVal.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// setReflectValue assigns value to field, converting it when the underlying
+// driver value's type doesn't exactly match the field's type (e.g. int64 to int).
+func setReflectValue(field reflect.Value, value interface{}) {
+	if value == nil {
+		return
+	}
+
+	valueVal := reflect.ValueOf(value)
+	if valueVal.Type().ConvertibleTo(field.Type()) {
+		field.Set(valueVal.Convert(field.Type()))
+	}
+}
+
+// flushInsertCopyFrom streams a batch insert's buffered rows into PostgreSQL
+// via COPY FROM STDIN (pq.CopyIn), which is a single round-trip and avoids
+// building an extended VALUES list entirely.
+func (d *DB) flushInsertCopyFrom(ctx context.Context, in *insert) (err error) {
+	table, columns, err := parseInsertInto(in.queryPart1)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for i := 0; i+len(columns) <= len(in.bindParams); i += len(columns) {
+		if _, err = stmt.ExecContext(ctx, in.bindParams[i:i+len(columns)]...); err != nil {
+			_ = stmt.Close()
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err = stmt.Close(); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// Reset vars
+	in.values = " VALUES"
+	in.bindParams = make([]interface{}, 0)
+	in.insertCtr = 0
+	in.byteEstimate = 0
+	in.createdAt = time.Time{}
+
+	return nil
+}
+
+// errCopyFromUnsupportedShape is returned (wrapped) by parseInsertInto when
+// queryPart1 doesn't carry an explicit column list, e.g.
+// "INSERT INTO t VALUES (?, ?)". COPY FROM STDIN has no way to infer columns
+// from a bare VALUES tuple, so flushInsert falls back to the extended-VALUES
+// INSERT path rather than failing the flush outright.
+var errCopyFromUnsupportedShape = errors.New("fastsql: query has no explicit column list")
+
+// parseInsertInto pulls the table name and column list out of the
+// "INSERT INTO table (col1, col2, ...)" portion of a batch-insert query.
+func parseInsertInto(queryPart1 string) (table string, columns []string, err error) {
+	matches := insertIntoRegexp.FindStringSubmatch(queryPart1)
+	if matches == nil {
+		return "", nil, fmt.Errorf("%w: %q", errCopyFromUnsupportedShape, queryPart1)
+	}
+
+	table = matches[1]
+
+	for _, col := range strings.Split(matches[2], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(col), "`\"[]"))
+	}
+
+	return table, columns, nil
+}
+
+// Tx is a transaction handle that embeds the standard library's sql.Tx
+// struct and carries its own batch-insert state, so that BatchInsert calls
+// made against it flush on the transaction's own connection instead of the
+// parent DB's.
+type Tx struct {
+	*sql.Tx
+	prepstmts     map[string]*sql.Stmt
+	driverName    string
+	flushInterval uint
+	batchInserts  map[string]*insert
+	mu            sync.Mutex
+}
+
+// Begin starts a transaction and returns a *fastsql.Tx that batches inserts
+// against it, inheriting driverName and flushInterval from d.
+func (d *DB) Begin() (*Tx, error) {
+	sqlTx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		Tx:            sqlTx,
+		prepstmts:     make(map[string]*sql.Stmt),
+		driverName:    d.driverName,
+		flushInterval: d.flushInterval,
+		batchInserts:  make(map[string]*insert),
+	}, nil
+}
+
+// BatchInsert is DB.BatchInsert, but the batch flushes against this
+// transaction's connection via tx.Prepare rather than against the parent DB.
+func (t *Tx) BatchInsert(query string, params ...interface{}) (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.batchInserts[query]; !ok {
+		t.batchInserts[query] = newInsert()
+	} //if
+
+	in := t.batchInserts[query]
+
+	// Only split out query the first time Insert is called
+	if in.queryPart1 == "" {
+		if err = in.splitQuery(query); err != nil {
+			delete(t.batchInserts, query)
+			return err
+		}
+	}
+
+	in.insertCtr++
+
+	// Build VALUES seciton of query and add to parameter slice
+	in.values += in.queryPart2
+	in.bindParams = append(in.bindParams, params...)
+
+	// If the batch interval has been hit, execute a batch insert
+	if in.insertCtr >= t.flushInterval {
+		err = t.flushInsert(in)
+	}
+
+	return err
+}
+
+// FlushAll iterates over all batch inserts buffered on this transaction and
+// inserts them, still within the transaction.
+func (t *Tx) FlushAll() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, in := range t.batchInserts {
+		if err := t.flushInsert(in); err != nil {
+			t.batchInserts = map[string]*insert{}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushInsert performs the actual batch-insert query against the
+// transaction's connection.
+func (t *Tx) flushInsert(in *insert) error {
+	var (
+		err   error
+		query = in.queryPart1 + in.values[:len(in.values)-1] + in.queryPart3
+	)
+
+	if _, ok := t.prepstmts[query]; !ok {
+		var stmt *sql.Stmt
+
+		// splitQuery leaves "?" placeholders regardless of driver; Postgres
+		// requires its native $1, $2, ... ordinal markers instead.
+		if stmt, err = t.Tx.Prepare(rewritePlaceholders(t.driverName, query)); err == nil {
+			t.prepstmts[query] = stmt
+		} else {
+			return err
+		}
+	}
+
+	if _, err = t.prepstmts[query].Exec(in.bindParams...); err != nil {
+		return err
+	}
+
+	// Reset vars
+	in.values = " VALUES"
+	in.bindParams = make([]interface{}, 0)
+	in.insertCtr = 0
+
+	return err
+}
+
+// Commit flushes any buffered batch inserts and then commits the
+// transaction.
+func (t *Tx) Commit() error {
+	if err := t.FlushAll(); err != nil {
+		return err
+	}
+
+	return t.Tx.Commit()
+}
+
+// Rollback discards any buffered batch inserts without executing them, then
+// rolls back the transaction.
+func (t *Tx) Rollback() error {
+	t.mu.Lock()
+	t.batchInserts = make(map[string]*insert)
+	t.mu.Unlock()
+
+	return t.Tx.Rollback()
+}
+
+func (d *DB) setDB(dbh *sql.DB) (err error) {
+	if err = dbh.Ping(); err != nil {
+		return err
+	}
+
+	d.DB = dbh
+	return nil
+}
+
+type insert struct {
+	bindParams   []interface{}
+	insertCtr    uint
+	queryPart1   string
+	queryPart2   string
+	queryPart3   string
+	values       string
+	origQuery    string
+	returning    bool
+	returningDst interface{}
+	byteEstimate int
+	createdAt    time.Time
+}
+
+// estimateParamSize returns a rough byte-size estimate for a single bound
+// parameter, used to drive FlushPolicy.MaxBytes.
+func estimateParamSize(param interface{}) int {
+	switch v := param.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	default:
+		return 8
+	}
+}
+
+func newInsert() *insert {
+	return &insert{
+		bindParams: make([]interface{}, 0),
+		values:     " VALUES",
+	}
+}
+
+// UnsupportedQueryError reports that a query given to BatchInsert,
+// BatchInsertReturning, or Tx.BatchInsert isn't a shape splitQuery can
+// safely rewrite into a batch insert (e.g. INSERT ... SELECT with no VALUES
+// clause at all). Callers can use errors.As to distinguish this from a
+// transient Prepare/Exec failure bubbling out of the same error return, and
+// should fix the query rather than retry.
+type UnsupportedQueryError struct {
+	Query  string
+	Reason string
+}
+
+func (e *UnsupportedQueryError) Error() string {
+	return fmt.Sprintf("fastsql: %s: %q", e.Reason, e.Query)
+}
+
+// splitQuery carves a single-row INSERT statement into the portion preceding
+// VALUES (queryPart1), the placeholder tuple for one row plus a trailing
+// comma (queryPart2), and, if present, a trailing upsert clause (queryPart3:
+// MySQL's ON DUPLICATE KEY UPDATE or PostgreSQL's ON CONFLICT). It locates
+// both by tokenizing the query with quote- and paren-depth awareness, rather
+// than by regex, so it isn't fooled by a "values" column, a string literal
+// containing "VALUES"/"ON CONFLICT", or a subquery paren inside an upsert
+// clause. It returns an *UnsupportedQueryError if query isn't a shape
+// BatchInsert can safely rewrite.
+func (in *insert) splitQuery(query string) error {
+	tokens := tokenizeSQL(query)
+
+	valuesTok, ok := findTopLevelToken(tokens, "values", 0)
+	if !ok {
+		return &UnsupportedQueryError{Query: query, Reason: "no top-level VALUES clause found; BatchInsert only supports INSERT ... VALUES (...) statements"}
+	}
+
+	runes := []rune(query)
+
+	tupleOpen := valuesTok.end
+	for tupleOpen < len(runes) && unicode.IsSpace(runes[tupleOpen]) {
+		tupleOpen++
+	}
+
+	if tupleOpen >= len(runes) || runes[tupleOpen] != '(' {
+		return &UnsupportedQueryError{Query: query, Reason: "expected a placeholder tuple \"(...)\" right after VALUES"}
+	}
+
+	tupleClose, ok := matchingParen(query, tupleOpen)
+	if !ok {
+		return &UnsupportedQueryError{Query: query, Reason: "unbalanced parens in the VALUES tuple"}
+	}
+
+	dupeTok, dupeFound := findTopLevelPhrase(tokens, []string{"on", "duplicate", "key", "update"}, tupleClose)
+	conflictTok, conflictFound := findTopLevelPhrase(tokens, []string{"on", "conflict"}, tupleClose)
+
+	in.queryPart1 = strings.TrimSpace(string(runes[:valuesTok.start]))
+
+	switch {
+	case dupeFound:
+		in.queryPart2 = " " + strings.TrimSpace(string(runes[valuesTok.end:dupeTok.start])) + ","
+		in.queryPart3 = string(runes[dupeTok.start:])
+	case conflictFound:
+		in.queryPart2 = " " + strings.TrimSpace(string(runes[valuesTok.end:conflictTok.start])) + ","
+		in.queryPart3 = string(runes[conflictTok.start:])
+	default:
+		in.queryPart2 = " " + strings.TrimSpace(string(runes[valuesTok.end:tupleClose])) + ","
+	}
+
+	return nil
+}
+
+// sqlToken is a lowercased word token produced by tokenizeSQL, along with its
+// rune offsets in the original query and the paren depth it was found at.
+type sqlToken struct {
+	text  string
+	start int
+	end   int
+	depth int
+}
+
+// tokenizeSQL splits query into lowercased word tokens (runs of letters,
+// digits, and underscores), skipping anything inside a single-quoted string,
+// double-quoted identifier, or backtick identifier, and records the paren
+// depth each token was found at.
+func tokenizeSQL(query string) []sqlToken {
+	runes := []rune(query)
+	depth := make([]int, len(runes))
+	inQuote := make([]bool, len(runes))
+
+	d := 0
+	inQ := false
+	var quoteChar rune
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		depth[i] = d
+		inQuote[i] = inQ
+
+		if inQ {
+			if r == quoteChar {
+				if quoteChar == '\'' && i+1 < len(runes) && runes[i+1] == '\'' {
+					i++
+					if i < len(runes) {
+						depth[i] = d
+						inQuote[i] = true
+					}
+					continue
+				}
+				inQ = false
+			}
+			continue
+		}
+
+		switch r {
+		case '\'', '"', '`':
+			inQ = true
+			quoteChar = r
+		case '(':
+			d++
+		case ')':
+			if d > 0 {
+				d--
+			}
+		}
+	}
+
+	var tokens []sqlToken
+	for i := 0; i < len(runes); {
+		if inQuote[i] || !(unicode.IsLetter(runes[i]) || runes[i] == '_') {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && !inQuote[j] && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+			j++
+		}
+
+		tokens = append(tokens, sqlToken{text: strings.ToLower(string(runes[i:j])), start: i, end: j, depth: depth[i]})
+		i = j
+	}
+
+	return tokens
+}
+
+// findTopLevelToken returns the first token matching word at paren depth 0,
+// starting at or after the rune index fromIndex.
+func findTopLevelToken(tokens []sqlToken, word string, fromIndex int) (sqlToken, bool) {
+	for _, t := range tokens {
+		if t.start < fromIndex {
+			continue
+		}
+
+		if t.depth == 0 && t.text == word {
+			return t, true
+		}
+	}
+
+	return sqlToken{}, false
+}
+
+// findTopLevelPhrase returns the first token of the earliest run of tokens
+// matching words in order, all at paren depth 0, starting at or after the
+// rune index fromIndex.
+func findTopLevelPhrase(tokens []sqlToken, words []string, fromIndex int) (sqlToken, bool) {
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		if tokens[i].start < fromIndex {
+			continue
+		}
+
+		matched := true
+		for k, w := range words {
+			if tokens[i+k].depth != 0 || tokens[i+k].text != w {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return tokens[i], true
+		}
+	}
+
+	return sqlToken{}, false
+}
+
+// matchingParen returns the rune index one past the ')' that closes the '('
+// at openIdx, tracking quoted strings so a paren inside a string literal
+// isn't mistaken for a real one.
+func matchingParen(query string, openIdx int) (int, bool) {
+	runes := []rune(query)
+	if openIdx >= len(runes) || runes[openIdx] != '(' {
+		return 0, false
+	}
+
+	depth := 0
+	inQuote := false
+	var quoteChar rune
+
+	for i := openIdx; i < len(runes); i++ {
+		r := runes[i]
+
+		if inQuote {
+			if r == quoteChar {
+				if quoteChar == '\'' && i+1 < len(runes) && runes[i+1] == '\'' {
+					i++
+					continue
+				}
+				inQuote = false
+			}
+			continue
+		}
+
+		switch r {
+		case '\'', '"', '`':
+			inQuote = true
+			quoteChar = r
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+type update struct {
+	table     string
+	pkCol     string
+	setCols   []string
+	rows      [][]interface{}
+	updateCtr uint
+}
+
+// newUpdate parses a single-row template such as
+// "UPDATE t SET col1=?, col2=? WHERE pk=?" into its table, SET columns, and
+// primary key column.
+func newUpdate(query string) (*update, error) {
+	matches := updateRegexp.FindStringSubmatch(query)
+	if matches == nil {
+		return nil, fmt.Errorf("fastsql: could not parse batch update template %q", query)
+	}
+
+	var setCols []string
+	for _, assignment := range strings.Split(matches[2], ",") {
+		col := strings.TrimSpace(assignment)
+		col = strings.TrimSuffix(col, "=?")
+		setCols = append(setCols, strings.TrimSpace(col))
+	}
+
+	return &update{
+		table:   matches[1],
+		setCols: setCols,
+		pkCol:   matches[3],
+		rows:    make([][]interface{}, 0),
+	}, nil
+}
+
+// dedupeUpdateRowsByPK collapses rows down to one row per distinct primary
+// key value (at index pkIdx), keeping the last-buffered row for each key and
+// otherwise preserving the order keys first appeared in.
+func dedupeUpdateRowsByPK(rows [][]interface{}, pkIdx int) [][]interface{} {
+	lastIdx := make(map[string]int, len(rows))
+	order := make([]string, 0, len(rows))
+
+	for i, row := range rows {
+		key := fmt.Sprint(row[pkIdx])
+		if _, ok := lastIdx[key]; !ok {
+			order = append(order, key)
+		}
+		lastIdx[key] = i
+	}
+
+	deduped := make([][]interface{}, len(order))
+	for i, key := range order {
+		deduped[i] = rows[lastIdx[key]]
+	}
+
+	return deduped
+}
+
+type deleteBatch struct {
+	table     string
+	pkCol     string
+	pkVals    []interface{}
+	deleteCtr uint
+}
+
+// newDeleteBatch parses a single-row template such as
+// "DELETE FROM t WHERE pk=?" into its table and primary key column.
+func newDeleteBatch(query string) (*deleteBatch, error) {
+	matches := deleteRegexp.FindStringSubmatch(query)
+	if matches == nil {
+		return nil, fmt.Errorf("fastsql: could not parse batch delete template %q", query)
+	}
+
+	return &deleteBatch{
+		table:  matches[1],
+		pkCol:  matches[2],
+		pkVals: make([]interface{}, 0),
+	}, nil
+}
+
+// preparedBatch holds the cached statements and row buffer for a named
+// PreparedBatchInsert batch.
+type preparedBatch struct {
+	baseQuery  string
+	prefix     string
+	colsPerRow int
+	batchSize  int
+	buffered   [][]interface{}
+	fullStmt   *sql.Stmt
+	tailStmt   *sql.Stmt
+	tailSize   int
+}
+
+// splitValuesTemplate splits a single-row INSERT statement into the portion
+// preceding "VALUES" (including the keyword) and the placeholder tuple that
+// follows it, e.g. "INSERT INTO t (a, b) VALUES (?, ?)" becomes
+// "INSERT INTO t (a, b) VALUES " and "(?, ?)".
+func splitValuesTemplate(query string) (prefix, tuple string, err error) {
+	valuesMatches := valuesRegexp.FindStringIndex(query)
+	if len(valuesMatches) == 0 {
+		return "", "", fmt.Errorf("fastsql: no VALUES clause found in %q", query)
+	}
+
+	rest := query[valuesMatches[1]:]
+
+	ndxOpen := strings.Index(rest, "(")
+	ndxClose := strings.Index(rest, ")")
+	if ndxOpen == -1 || ndxClose == -1 || ndxClose < ndxOpen {
+		return "", "", fmt.Errorf("fastsql: no placeholder tuple found in %q", query)
+	}
+
+	prefix = query[:valuesMatches[1]] + " "
+	tuple = rest[ndxOpen : ndxClose+1]
+
+	return prefix, tuple, nil
+}
+
+// rewritePlaceholders converts the "?" bind placeholders in query into
+// PostgreSQL's native ordinal markers ($1, $2, ...) when driverName is
+// "postgres" or "pgx" — both require them, since a literal "?" isn't a bind
+// parameter to the Postgres wire protocol — and leaves query untouched for
+// every other driver. A "?" inside a single/double-quoted string or
+// backtick identifier is left alone.
+func rewritePlaceholders(driverName, query string) string {
+	if driverName != "postgres" && driverName != "pgx" {
+		return query
+	}
+
+	var (
+		b         strings.Builder
+		n         int
+		inQuote   bool
+		quoteChar rune
+		runes     = []rune(query)
+	)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if inQuote {
+			b.WriteRune(r)
+			if r == quoteChar {
+				if quoteChar == '\'' && i+1 < len(runes) && runes[i+1] == '\'' {
+					i++
+					b.WriteRune(runes[i])
+					continue
+				}
+				inQuote = false
+			}
+			continue
+		}
+
+		switch r {
+		case '\'', '"', '`':
+			inQuote = true
+			quoteChar = r
+			b.WriteRune(r)
+		case '?':
+			n++
+			b.WriteString("$")
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// buildBatchQuery repeats a single-row placeholder tuple rows times and joins
+// them onto prefix, rewriting placeholders to $1..$N when driverName is
+// PostgreSQL ("postgres" or "pgx") and leaving "?" placeholders otherwise.
+func buildBatchQuery(driverName, prefix string, colsPerRow, rows int) string {
+	tuples := make([]string, rows)
+
+	if driverName == "postgres" || driverName == "pgx" {
+		n := 1
+		for r := 0; r < rows; r++ {
+			cols := make([]string, colsPerRow)
+			for c := 0; c < colsPerRow; c++ {
+				cols[c] = "$" + strconv.Itoa(n)
+				n++
+			}
+			tuples[r] = "(" + strings.Join(cols, ", ") + ")"
+		}
+	} else {
+		cols := make([]string, colsPerRow)
+		for c := range cols {
+			cols[c] = "?"
+		}
+		tuple := "(" + strings.Join(cols, ", ") + ")"
+
+		for r := range tuples {
+			tuples[r] = tuple
+		}
+	}
+
+	return prefix + strings.Join(tuples, ", ")
 }
@@ -0,0 +1,67 @@
+package fastsql
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestFlushPolicyBackgroundFlusher exercises the background flusher goroutine
+// started by SetFlushPolicy: a batch insert that's never hit its row-count
+// trigger should still get flushed once it ages past FlushPolicy.MaxAge.
+func TestFlushPolicyBackgroundFlusher(t *testing.T) {
+	dsn := t.Name()
+
+	db, err := Open("fastsql_fake", dsn, 1000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	stateIface, _ := fakeConnStates.LoadOrStore(dsn, &fakeConnState{})
+	state := stateIface.(*fakeConnState)
+
+	db.SetFlushPolicy(FlushPolicy{MaxAge: 20 * time.Millisecond})
+
+	if err := db.BatchInsert("INSERT INTO t (a) VALUES (?)", 1); err != nil {
+		t.Fatalf("BatchInsert: %v", err)
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for atomic.LoadInt32(&state.execCount) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("background flusher never executed the aged-out batch")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSetFlushPolicyRestartsFlusher verifies that calling SetFlushPolicy a
+// second time stops the previous flusher goroutine rather than leaking it
+// alongside a new one (SetFlushPolicy's doc comment promises this).
+func TestSetFlushPolicyRestartsFlusher(t *testing.T) {
+	db, err := Open("fastsql_fake", t.Name(), 1000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	db.SetFlushPolicy(FlushPolicy{MaxAge: time.Hour})
+	firstStop := db.flusherStop
+
+	db.SetFlushPolicy(FlushPolicy{MaxAge: time.Hour})
+	secondStop := db.flusherStop
+
+	select {
+	case <-firstStop:
+		// Closed, as expected: stopFlusher closed it before the second
+		// goroutine was started.
+	default:
+		t.Error("first flusher's stop channel was not closed by the second SetFlushPolicy call")
+	}
+
+	if firstStop == secondStop {
+		t.Error("SetFlushPolicy reused the previous stop channel instead of starting a fresh flusher")
+	}
+}
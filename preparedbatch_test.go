@@ -0,0 +1,51 @@
+package fastsql
+
+import "testing"
+
+func TestSplitValuesTemplate(t *testing.T) {
+	prefix, tuple, err := splitValuesTemplate("INSERT INTO t (a, b) VALUES (?, ?)")
+	if err != nil {
+		t.Fatalf("splitValuesTemplate returned unexpected error: %v", err)
+	}
+
+	if want := "INSERT INTO t (a, b) VALUES "; prefix != want {
+		t.Errorf("prefix = %q, want %q", prefix, want)
+	}
+
+	if want := "(?, ?)"; tuple != want {
+		t.Errorf("tuple = %q, want %q", tuple, want)
+	}
+}
+
+func TestSplitValuesTemplateNoValuesClause(t *testing.T) {
+	if _, _, err := splitValuesTemplate("INSERT INTO t (a, b) SELECT x, y FROM other"); err == nil {
+		t.Fatal("splitValuesTemplate(no VALUES clause) = nil error, want an error")
+	}
+}
+
+func TestBuildBatchQueryMySQL(t *testing.T) {
+	got := buildBatchQuery("mysql", "INSERT INTO t (a, b) VALUES ", 2, 3)
+	want := "INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, ?)"
+
+	if got != want {
+		t.Errorf("buildBatchQuery(mysql) = %q, want %q", got, want)
+	}
+}
+
+func TestBuildBatchQueryPostgres(t *testing.T) {
+	got := buildBatchQuery("postgres", "INSERT INTO t (a, b) VALUES ", 2, 3)
+	want := "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4), ($5, $6)"
+
+	if got != want {
+		t.Errorf("buildBatchQuery(postgres) = %q, want %q", got, want)
+	}
+}
+
+func TestBuildBatchQueryPgx(t *testing.T) {
+	got := buildBatchQuery("pgx", "INSERT INTO t (a) VALUES ", 1, 2)
+	want := "INSERT INTO t (a) VALUES ($1), ($2)"
+
+	if got != want {
+		t.Errorf("buildBatchQuery(pgx) = %q, want %q", got, want)
+	}
+}
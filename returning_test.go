@@ -0,0 +1,71 @@
+package fastsql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppendReturnedRowStruct(t *testing.T) {
+	type row struct {
+		ID   int
+		Name string
+	}
+
+	var dst []row
+
+	if err := appendReturnedRow(&dst, []string{"id", "name"}, []interface{}{int64(1), "alice"}); err != nil {
+		t.Fatalf("appendReturnedRow returned unexpected error: %v", err)
+	}
+
+	if err := appendReturnedRow(&dst, []string{"id", "name"}, []interface{}{int64(2), "bob"}); err != nil {
+		t.Fatalf("appendReturnedRow returned unexpected error: %v", err)
+	}
+
+	if len(dst) != 2 {
+		t.Fatalf("len(dst) = %d, want 2", len(dst))
+	}
+
+	if dst[0].ID != 1 || dst[0].Name != "alice" {
+		t.Errorf("dst[0] = %+v, want {ID:1 Name:alice}", dst[0])
+	}
+
+	if dst[1].ID != 2 || dst[1].Name != "bob" {
+		t.Errorf("dst[1] = %+v, want {ID:2 Name:bob}", dst[1])
+	}
+}
+
+func TestAppendReturnedRowScalar(t *testing.T) {
+	var dst []int
+
+	if err := appendReturnedRow(&dst, []string{"id"}, []interface{}{int64(42)}); err != nil {
+		t.Fatalf("appendReturnedRow returned unexpected error: %v", err)
+	}
+
+	if len(dst) != 1 || dst[0] != 42 {
+		t.Fatalf("dst = %v, want [42]", dst)
+	}
+}
+
+func TestAppendReturnedRowRejectsNonSlicePointer(t *testing.T) {
+	var dst int
+
+	if err := appendReturnedRow(&dst, []string{"id"}, []interface{}{int64(1)}); err == nil {
+		t.Fatal("appendReturnedRow(non-slice dst) = nil error, want an error")
+	}
+}
+
+func TestFindFieldByName(t *testing.T) {
+	type row struct {
+		UserID int
+	}
+
+	v := reflect.ValueOf(row{})
+
+	if f := findFieldByName(v, "userid"); !f.IsValid() {
+		t.Error("findFieldByName is case-sensitive, want case-insensitive match")
+	}
+
+	if f := findFieldByName(v, "missing"); f.IsValid() {
+		t.Error("findFieldByName found a field for a name with no match")
+	}
+}
@@ -0,0 +1,110 @@
+package fastsql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplitQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantPart1 string
+		wantPart2 string
+		wantPart3 string
+	}{
+		{
+			name:      "plain insert",
+			query:     "INSERT INTO t (a, b) VALUES (?, ?)",
+			wantPart1: "INSERT INTO t (a, b)",
+			wantPart2: " (?, ?),",
+		},
+		{
+			name:      "column literally named values",
+			query:     "INSERT INTO t (id, values) VALUES (?, ?)",
+			wantPart1: "INSERT INTO t (id, values)",
+			wantPart2: " (?, ?),",
+		},
+		{
+			name:      "string literal containing VALUES",
+			query:     "INSERT INTO t (a, b) VALUES (?, 'has VALUES inside')",
+			wantPart1: "INSERT INTO t (a, b)",
+			wantPart2: " (?, 'has VALUES inside'),",
+		},
+		{
+			name:      "on duplicate key update",
+			query:     "INSERT INTO t (a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE b=VALUES(b)",
+			wantPart1: "INSERT INTO t (a, b)",
+			wantPart2: " (?, ?),",
+			wantPart3: "ON DUPLICATE KEY UPDATE b=VALUES(b)",
+		},
+		{
+			name:      "on duplicate key update with subquery paren",
+			query:     "INSERT INTO t (a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE b = (SELECT max(b) FROM t)",
+			wantPart1: "INSERT INTO t (a, b)",
+			wantPart2: " (?, ?),",
+			wantPart3: "ON DUPLICATE KEY UPDATE b = (SELECT max(b) FROM t)",
+		},
+		{
+			name:      "on conflict",
+			query:     "INSERT INTO t (a, b) VALUES (?, ?) ON CONFLICT (a) DO UPDATE SET b = EXCLUDED.b",
+			wantPart1: "INSERT INTO t (a, b)",
+			wantPart2: " (?, ?),",
+			wantPart3: "ON CONFLICT (a) DO UPDATE SET b = EXCLUDED.b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newInsert()
+
+			if err := in.splitQuery(tt.query); err != nil {
+				t.Fatalf("splitQuery(%q) returned unexpected error: %v", tt.query, err)
+			}
+
+			if in.queryPart1 != tt.wantPart1 {
+				t.Errorf("queryPart1 = %q, want %q", in.queryPart1, tt.wantPart1)
+			}
+
+			if in.queryPart2 != tt.wantPart2 {
+				t.Errorf("queryPart2 = %q, want %q", in.queryPart2, tt.wantPart2)
+			}
+
+			if in.queryPart3 != tt.wantPart3 {
+				t.Errorf("queryPart3 = %q, want %q", in.queryPart3, tt.wantPart3)
+			}
+		})
+	}
+}
+
+func TestSplitQueryUnsupportedShape(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "insert select has no values clause",
+			query: "INSERT INTO t (a, b) SELECT x, y FROM other",
+		},
+		{
+			name:  "missing tuple after values",
+			query: "INSERT INTO t (a, b) VALUES",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newInsert()
+
+			err := in.splitQuery(tt.query)
+			if err == nil {
+				t.Fatalf("splitQuery(%q) = nil error, want *UnsupportedQueryError", tt.query)
+			}
+
+			var unsupported *UnsupportedQueryError
+			if !errors.As(err, &unsupported) {
+				t.Fatalf("splitQuery(%q) error = %v (%T), want *UnsupportedQueryError", tt.query, err, err)
+			}
+		})
+	}
+}
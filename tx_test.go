@@ -0,0 +1,72 @@
+package fastsql
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// TestTxCommitFlushesBufferedInserts verifies that a row buffered via
+// Tx.BatchInsert (but not yet past flushInterval) is executed once Commit is
+// called.
+func TestTxCommitFlushesBufferedInserts(t *testing.T) {
+	db, err := Open("fastsql_fake", t.Name(), 1000)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+
+	state, _ := fakeConnStates.LoadOrStore(t.Name(), &fakeConnState{})
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin returned unexpected error: %v", err)
+	}
+
+	if err := tx.BatchInsert("INSERT INTO t (a, b) VALUES (?, ?)", 1, 2); err != nil {
+		t.Fatalf("BatchInsert returned unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&state.(*fakeConnState).execCount); got != 0 {
+		t.Fatalf("execCount before Commit = %d, want 0", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit returned unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&state.(*fakeConnState).execCount); got != 1 {
+		t.Errorf("execCount after Commit = %d, want 1", got)
+	}
+}
+
+// TestTxRollbackDiscardsBufferedInserts verifies that a row buffered via
+// Tx.BatchInsert is discarded, never executed, when Rollback is called
+// instead of Commit.
+func TestTxRollbackDiscardsBufferedInserts(t *testing.T) {
+	db, err := Open("fastsql_fake", t.Name(), 1000)
+	if err != nil {
+		t.Fatalf("Open returned unexpected error: %v", err)
+	}
+
+	state, _ := fakeConnStates.LoadOrStore(t.Name(), &fakeConnState{})
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin returned unexpected error: %v", err)
+	}
+
+	if err := tx.BatchInsert("INSERT INTO t (a, b) VALUES (?, ?)", 1, 2); err != nil {
+		t.Fatalf("BatchInsert returned unexpected error: %v", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback returned unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&state.(*fakeConnState).execCount); got != 0 {
+		t.Errorf("execCount after Rollback = %d, want 0", got)
+	}
+
+	if len(tx.batchInserts) != 0 {
+		t.Errorf("batchInserts after Rollback = %d entries, want 0", len(tx.batchInserts))
+	}
+}